@@ -0,0 +1,278 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default bucket sizes for AddrBook, chosen to bound memory use on channels
+// that learn about a large number of addresses over their lifetime.
+const (
+	defaultNewBucketSize   = 256
+	defaultTriedBucketSize = 256
+)
+
+// addrBookEntry tracks everything the AddrBook knows about a single
+// host:port, independent of whether a *Peer currently exists for it.
+type addrBookEntry struct {
+	HostPort    string    `json:"hostPort"`
+	Source      string    `json:"source"`
+	Tried       bool      `json:"tried"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	Failures    int       `json:"failures"`
+}
+
+// score ranks entries within a bucket so the worst entry can be evicted when
+// the bucket is full. Lower is worse. Entries that have never succeeded and
+// have the most consecutive failures sort to the bottom.
+func (e *addrBookEntry) score() float64 {
+	score := 1.0
+	if !e.LastSuccess.IsZero() {
+		score += 10
+	}
+	score -= float64(e.Failures)
+	return score
+}
+
+// AddrBook tracks every host:port a Channel has ever learned about --
+// whether from static configuration, inbound connections, or peer gossip --
+// and buckets them into "new" (never successfully dialed) and "tried"
+// (successfully dialed at least once), modeled on Tendermint's address
+// book. It can be persisted to disk so a restart does not lose topology
+// knowledge.
+type AddrBook struct {
+	channel Connectable
+	peers   *PeerList
+
+	newBucketSize   int
+	triedBucketSize int
+
+	mut   sync.Mutex
+	new   map[string]*addrBookEntry
+	tried map[string]*addrBookEntry
+}
+
+// NewAddrBook creates an AddrBook backed by the given PeerList: addresses
+// picked from the book are resolved to Peers through GetOrAdd.
+func NewAddrBook(channel Connectable, peers *PeerList) *AddrBook {
+	return &AddrBook{
+		channel:         channel,
+		peers:           peers,
+		newBucketSize:   defaultNewBucketSize,
+		triedBucketSize: defaultTriedBucketSize,
+		new:             make(map[string]*addrBookEntry),
+		tried:           make(map[string]*addrBookEntry),
+	}
+}
+
+// addrBookFile is the on-disk JSON representation written by Save and read
+// by Load.
+type addrBookFile struct {
+	New   []*addrBookEntry `json:"new"`
+	Tried []*addrBookEntry `json:"tried"`
+}
+
+// AddAddress records that hostPort was learned about from source, if it is
+// not already known. Existing entries are left untouched.
+func (b *AddrBook) AddAddress(hostPort, source string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if _, ok := b.tried[hostPort]; ok {
+		return
+	}
+	if _, ok := b.new[hostPort]; ok {
+		return
+	}
+
+	b.evictIfFull(b.new, b.newBucketSize)
+	b.new[hostPort] = &addrBookEntry{HostPort: hostPort, Source: source}
+}
+
+// MarkAttempt records that a connection attempt to hostPort was made.
+func (b *AddrBook) MarkAttempt(hostPort string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	e := b.entryLocked(hostPort)
+	e.LastAttempt = time.Now()
+}
+
+// MarkGood records that a connection attempt to hostPort succeeded, promoting
+// the entry from the "new" bucket to the "tried" bucket.
+func (b *AddrBook) MarkGood(hostPort string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	e := b.entryLocked(hostPort)
+	e.LastSuccess = time.Now()
+	e.Failures = 0
+
+	if !e.Tried {
+		delete(b.new, hostPort)
+		b.evictIfFull(b.tried, b.triedBucketSize)
+		e.Tried = true
+		b.tried[hostPort] = e
+	}
+}
+
+// MarkBad records that a connection attempt to hostPort failed.
+func (b *AddrBook) MarkBad(hostPort string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	e := b.entryLocked(hostPort)
+	e.Failures++
+}
+
+// entryLocked returns the entry for hostPort, creating one in the "new"
+// bucket if it does not already exist. mut must be held.
+func (b *AddrBook) entryLocked(hostPort string) *addrBookEntry {
+	if e, ok := b.tried[hostPort]; ok {
+		return e
+	}
+	if e, ok := b.new[hostPort]; ok {
+		return e
+	}
+
+	b.evictIfFull(b.new, b.newBucketSize)
+	e := &addrBookEntry{HostPort: hostPort, Source: "unknown"}
+	b.new[hostPort] = e
+	return e
+}
+
+// evictIfFull removes the worst-scoring entry from bucket if it has reached
+// size. mut must be held.
+func (b *AddrBook) evictIfFull(bucket map[string]*addrBookEntry, size int) {
+	if len(bucket) < size {
+		return
+	}
+
+	var worstKey string
+	var worstScore float64
+	first := true
+	for k, e := range bucket {
+		if first || e.score() < worstScore {
+			worstKey, worstScore, first = k, e.score(), false
+		}
+	}
+	delete(bucket, worstKey)
+}
+
+// Pick samples a host:port from the address book, biased toward the "tried"
+// bucket by bias (0 always picks from "new", 1 always picks from "tried",
+// when both buckets are non-empty). If one bucket is empty, the other is
+// used regardless of bias. It returns false if the book is empty.
+func (b *AddrBook) Pick(bias float64) (string, bool) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	useTried := len(b.tried) > 0 && (len(b.new) == 0 || peerRng.Float64() < bias)
+	bucket := b.new
+	if useTried {
+		bucket = b.tried
+	}
+	if len(bucket) == 0 {
+		return "", false
+	}
+
+	i, n := peerRng.Intn(len(bucket)), 0
+	for k := range bucket {
+		if n == i {
+			return k, true
+		}
+		n++
+	}
+	return "", false
+}
+
+// Peer samples a host:port via Pick and resolves it to a *Peer via the
+// backing PeerList, creating one if necessary.
+func (b *AddrBook) Peer(bias float64) *Peer {
+	hostPort, ok := b.Pick(bias)
+	if !ok {
+		return nil
+	}
+	p, err := b.peers.GetOrAdd(hostPort)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// Save writes the address book to path as JSON.
+func (b *AddrBook) Save(path string) error {
+	b.mut.Lock()
+	file := addrBookFile{
+		New:   entryValues(b.new),
+		Tried: entryValues(b.tried),
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	b.mut.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, os.FileMode(0644))
+}
+
+// Load reads an address book previously written by Save from path,
+// replacing the in-memory contents of b.
+func (b *AddrBook) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file addrBookFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	b.new = make(map[string]*addrBookEntry, len(file.New))
+	for _, e := range file.New {
+		b.new[e.HostPort] = e
+	}
+
+	b.tried = make(map[string]*addrBookEntry, len(file.Tried))
+	for _, e := range file.Tried {
+		e.Tried = true
+		b.tried[e.HostPort] = e
+	}
+
+	return nil
+}
+
+func entryValues(m map[string]*addrBookEntry) []*addrBookEntry {
+	entries := make([]*addrBookEntry, 0, len(m))
+	for _, e := range m {
+		entries = append(entries, e)
+	}
+	return entries
+}
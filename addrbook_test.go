@@ -0,0 +1,103 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAddrBookEvictsWorstScoringEntryWhenBucketFull(t *testing.T) {
+	b := NewAddrBook(nil, nil)
+	b.newBucketSize = 2
+
+	b.AddAddress("a:1", "test")
+	b.MarkBad("a:1") // a:1 now scores worse than a fresh entry
+
+	b.AddAddress("b:1", "test")
+	b.AddAddress("c:1", "test") // bucket is full; a:1 should be evicted
+
+	if _, ok := b.new["a:1"]; ok {
+		t.Fatalf("expected a:1 to be evicted, new bucket = %v", b.new)
+	}
+	if _, ok := b.new["c:1"]; !ok {
+		t.Fatalf("expected c:1 to be kept, new bucket = %v", b.new)
+	}
+}
+
+func TestAddrBookPickBias(t *testing.T) {
+	b := NewAddrBook(nil, nil)
+	b.AddAddress("new:1", "test")
+	b.MarkGood("tried:1") // creates the entry and promotes it to "tried"
+
+	if hp, ok := b.Pick(0); !ok || hp != "new:1" {
+		t.Fatalf("Pick(0) = (%q, %v), want (new:1, true)", hp, ok)
+	}
+	if hp, ok := b.Pick(1); !ok || hp != "tried:1" {
+		t.Fatalf("Pick(1) = (%q, %v), want (tried:1, true)", hp, ok)
+	}
+}
+
+func TestAddrBookPickEmpty(t *testing.T) {
+	b := NewAddrBook(nil, nil)
+	if _, ok := b.Pick(0.5); ok {
+		t.Fatalf("Pick on empty book should return false")
+	}
+}
+
+// TestAddrBookSaveDoesNotRaceWithConcurrentMarks exercises Save
+// concurrently with MarkBad to catch the regression where Save collected
+// pointers to live entries and ran json.MarshalIndent after releasing the
+// lock, letting a concurrent Mark* mutate those entries mid-marshal. Run
+// with -race to verify.
+func TestAddrBookSaveDoesNotRaceWithConcurrentMarks(t *testing.T) {
+	b := NewAddrBook(nil, nil)
+	for i := 0; i < 50; i++ {
+		b.AddAddress(fmt.Sprintf("host%d:1", i), "test")
+	}
+
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				b.MarkBad("host0:1")
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if err := b.Save(path); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrPeerBlocked is returned by PeerList.Add and PeerList.GetOrAdd when the
+// requested host:port is blocked by the channel's IPBlocklist.
+var ErrPeerBlocked = errors.New("peer is blocked")
+
+// IPBlocklist holds a set of CIDR ranges and exact host:port entries that
+// should be refused as peers, modeled on the iplist.Ranger used by the
+// anacrolix/torrent client to gate peer acceptance. It supports atomic
+// hot-reload so operators can drop abusive hosts without restarting.
+type IPBlocklist struct {
+	entries atomic.Value // holds blocklistEntries
+}
+
+// blocklistEntries is the immutable snapshot swapped under IPBlocklist.entries.
+type blocklistEntries struct {
+	ranges    []blockedRange
+	hostPorts map[string]string
+}
+
+type blockedRange struct {
+	net    *net.IPNet
+	reason string
+}
+
+// NewIPBlocklist returns an empty IPBlocklist; entries are added with Set or
+// LoadFile.
+func NewIPBlocklist() *IPBlocklist {
+	b := &IPBlocklist{}
+	b.entries.Store(blocklistEntries{hostPorts: make(map[string]string)})
+	return b
+}
+
+// Set atomically replaces the blocklist's contents. cidrs maps a CIDR
+// string (e.g. "10.0.0.0/8") to the reason it is blocked; hostPorts maps an
+// exact "host:port" string to its reason.
+func (b *IPBlocklist) Set(cidrs map[string]string, hostPorts map[string]string) error {
+	ranges := make([]blockedRange, 0, len(cidrs))
+	for cidr, reason := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %v", cidr, err)
+		}
+		ranges = append(ranges, blockedRange{net: ipNet, reason: reason})
+	}
+
+	hp := make(map[string]string, len(hostPorts))
+	for hostPort, reason := range hostPorts {
+		hp[hostPort] = reason
+	}
+
+	b.entries.Store(blocklistEntries{ranges: ranges, hostPorts: hp})
+	return nil
+}
+
+// LoadFile atomically reloads the blocklist from a file with one entry per
+// line, in the form "<cidr-or-host:port> <reason>". Blank lines and lines
+// starting with "#" are ignored. A bare IP is treated as a /32 (or /128)
+// CIDR.
+func (b *IPBlocklist) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cidrs := make(map[string]string)
+	hostPorts := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		entry := fields[0]
+		reason := ""
+		if len(fields) == 2 {
+			reason = strings.TrimSpace(fields[1])
+		}
+
+		if strings.Contains(entry, "/") {
+			cidrs[entry] = reason
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() != nil {
+				cidrs[entry+"/32"] = reason
+			} else {
+				cidrs[entry+"/128"] = reason
+			}
+			continue
+		}
+		hostPorts[entry] = reason
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return b.Set(cidrs, hostPorts)
+}
+
+// Lookup reports whether addr (a "host:port" string, or a bare host/IP) is
+// blocked, and if so, the reason it was added to the blocklist.
+func (b *IPBlocklist) Lookup(addr string) (reason string, blocked bool) {
+	e := b.entries.Load().(blocklistEntries)
+
+	if reason, ok := e.hostPorts[addr]; ok {
+		return reason, true
+	}
+
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", false
+	}
+
+	for _, r := range e.ranges {
+		if r.net.Contains(ip) {
+			return r.reason, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPBlocklistLookupExactHostPort(t *testing.T) {
+	b := NewIPBlocklist()
+	if err := b.Set(nil, map[string]string{"10.0.0.1:4040": "abusive"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if reason, blocked := b.Lookup("10.0.0.1:4040"); !blocked || reason != "abusive" {
+		t.Fatalf("Lookup(10.0.0.1:4040) = (%q, %v), want (abusive, true)", reason, blocked)
+	}
+	if _, blocked := b.Lookup("10.0.0.2:4040"); blocked {
+		t.Fatalf("Lookup(10.0.0.2:4040) should not be blocked")
+	}
+}
+
+func TestIPBlocklistLookupCIDR(t *testing.T) {
+	b := NewIPBlocklist()
+	if err := b.Set(map[string]string{"10.0.0.0/8": "internal"}, nil); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if reason, blocked := b.Lookup("10.1.2.3:4040"); !blocked || reason != "internal" {
+		t.Fatalf("Lookup(10.1.2.3:4040) = (%q, %v), want (internal, true)", reason, blocked)
+	}
+	if _, blocked := b.Lookup("11.1.2.3:4040"); blocked {
+		t.Fatalf("Lookup(11.1.2.3:4040) should not be blocked")
+	}
+}
+
+func TestIPBlocklistSetRejectsInvalidCIDR(t *testing.T) {
+	b := NewIPBlocklist()
+	if err := b.Set(map[string]string{"not-a-cidr": "bad"}, nil); err == nil {
+		t.Fatalf("Set with an invalid CIDR should return an error")
+	}
+}
+
+func TestIPBlocklistLoadFileParsesCIDRsBareIPsAndHostPorts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	contents := "" +
+		"# comment\n" +
+		"\n" +
+		"10.0.0.0/8 internal range\n" +
+		"192.168.1.5 bare ip\n" +
+		"example.com:4040 exact host:port\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	b := NewIPBlocklist()
+	if err := b.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	if reason, blocked := b.Lookup("10.2.3.4:1"); !blocked || reason != "internal range" {
+		t.Fatalf("Lookup(10.2.3.4:1) = (%q, %v), want (internal range, true)", reason, blocked)
+	}
+	if reason, blocked := b.Lookup("192.168.1.5:9"); !blocked || reason != "bare ip" {
+		t.Fatalf("Lookup(192.168.1.5:9) = (%q, %v), want (bare ip, true)", reason, blocked)
+	}
+	if reason, blocked := b.Lookup("example.com:4040"); !blocked || reason != "exact host:port" {
+		t.Fatalf("Lookup(example.com:4040) = (%q, %v), want (exact host:port, true)", reason, blocked)
+	}
+}
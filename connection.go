@@ -0,0 +1,138 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// connectionState tracks where a Connection is in its lifecycle.
+type connectionState int
+
+const (
+	connectionWaitingToRecvInitReq connectionState = iota
+	connectionWaitingToRecvInitRes
+	connectionActive
+	connectionStartClose
+	connectionClosed
+)
+
+// PeerInfo identifies the remote end of a Connection.
+type PeerInfo struct {
+	HostPort    string
+	ProcessName string
+	IsEphemeral bool
+}
+
+// SystemErrCode classifies a SystemError frame sent in lieu of a response.
+type SystemErrCode int
+
+// ErrCodeBusy indicates the receiver is refusing the connection or call,
+// e.g. because the remote address is blocked.
+const ErrCodeBusy SystemErrCode = 3
+
+// SystemError is a protocol-level error sent back to a caller instead of an
+// application response.
+type SystemError struct {
+	Code SystemErrCode
+	msg  string
+}
+
+func (e SystemError) Error() string { return e.msg }
+
+// NewSystemError creates a SystemError with the given code and formatted message.
+func NewSystemError(code SystemErrCode, format string, args ...interface{}) error {
+	return SystemError{Code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// frameOverhead approximates the fixed cost of a TChannel frame header, used
+// to size the traffic counters in ConnStats when the exact wire size isn't
+// tracked separately.
+const frameOverhead = 16
+
+// Connection represents a single multiplexed TCP connection to a peer.
+type Connection struct {
+	mut            sync.RWMutex
+	state          connectionState
+	remotePeerInfo PeerInfo
+
+	stats connStats
+}
+
+func (c *Connection) readState() connectionState {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.state
+}
+
+// IsActive reports whether the connection is in a state that can be used to
+// make or accept calls.
+func (c *Connection) IsActive() bool {
+	return c.readState() == connectionActive
+}
+
+// RemotePeerInfo returns the identity the remote side of this connection
+// advertised during the initial handshake.
+func (c *Connection) RemotePeerInfo() PeerInfo {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.remotePeerInfo
+}
+
+// Close closes the connection.
+func (c *Connection) Close() {
+	c.mut.Lock()
+	c.state = connectionClosed
+	c.mut.Unlock()
+}
+
+// SendSystemError accounts a protocol-level error frame of frameOverhead
+// bytes against the connection's outbound stats. This Connection has no
+// write path, so nothing is transmitted to the remote peer.
+func (c *Connection) SendSystemError(err error) error {
+	c.recordFrameOut(frameOverhead)
+	return nil
+}
+
+// recordFrameIn accounts for a single inbound frame of n bytes. It is called
+// when a response's Arg2Reader or Arg3Reader is opened.
+func (c *Connection) recordFrameIn(n uint64) {
+	c.stats.recordFrameIn(n)
+}
+
+// recordFrameOut accounts for a single outbound frame of n bytes. It is
+// called by beginCall, SendSystemError, and each Write to a call's
+// Arg2Writer or Arg3Writer.
+func (c *Connection) recordFrameOut(n uint64) {
+	c.stats.recordFrameOut(n)
+}
+
+// beginCall starts a new outbound call on this connection. onComplete is
+// passed through to the OutboundCall so it is set before the call's
+// context-watcher goroutine starts, rather than patched on afterward.
+func (c *Connection) beginCall(ctx context.Context, serviceName string, callOptions *CallOptions, operationName string, onComplete func(success bool)) (*OutboundCall, error) {
+	c.stats.recordCallStarted()
+	c.recordFrameOut(frameOverhead)
+	return newOutboundCall(ctx, c, serviceName, operationName, onComplete), nil
+}
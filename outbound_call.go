@@ -0,0 +1,157 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// OutboundCall represents an in-progress call from this process to a peer.
+// Arg2Writer/Arg3Writer write the call's arguments; Response reads back the
+// peer's reply.
+type OutboundCall struct {
+	conn          *Connection
+	serviceName   string
+	operationName string
+
+	mut          sync.Mutex
+	response     *OutboundCallResponse
+	onComplete   func(success bool)
+	completeOnce sync.Once
+}
+
+// newOutboundCall creates the call with onComplete already set, and only
+// then starts watchContext. onComplete is never written again after this,
+// so the watcher goroutine can read c.onComplete in complete() without
+// synchronization.
+func newOutboundCall(ctx context.Context, conn *Connection, serviceName, operationName string, onComplete func(success bool)) *OutboundCall {
+	call := &OutboundCall{
+		conn:          conn,
+		serviceName:   serviceName,
+		operationName: operationName,
+		onComplete:    onComplete,
+	}
+	go call.watchContext(ctx)
+	return call
+}
+
+// watchContext marks the call failed as soon as ctx is done, unless it has
+// already completed normally. This is what accounts for calls that error,
+// time out, or are abandoned by the caller without ever reading through to
+// Arg3Reader.Close: without it, only a clean success path ever released the
+// call's outstanding-count and RecordCallResult bookkeeping, leaking both
+// forever on any other outcome. completeOnce makes this a no-op for calls
+// that already finished.
+func (c *OutboundCall) watchContext(ctx context.Context) {
+	<-ctx.Done()
+	c.complete(false)
+}
+
+// Arg2Writer returns a writer for the call's second argument (headers).
+func (c *OutboundCall) Arg2Writer() (io.WriteCloser, error) {
+	return &argWriteCloser{conn: c.conn}, nil
+}
+
+// Arg3Writer returns a writer for the call's third argument (body).
+func (c *OutboundCall) Arg3Writer() (io.WriteCloser, error) {
+	return &argWriteCloser{conn: c.conn}, nil
+}
+
+// Response returns the response to this call, creating it on first use.
+func (c *OutboundCall) Response() *OutboundCallResponse {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.response == nil {
+		c.response = &OutboundCallResponse{call: c}
+	}
+	return c.response
+}
+
+// complete runs the call's completion callback (if any) exactly once,
+// whichever of its callers gets there first: a clean Arg3Reader.Close (with
+// success=true) or watchContext noticing the call's context ended first
+// (with success=false). It marks the call finished for the purposes of
+// Peer.RecordCallResult and per-connection call stats.
+func (c *OutboundCall) complete(success bool) {
+	c.completeOnce.Do(func() {
+		c.conn.stats.recordCallDone(success)
+		if c.onComplete != nil {
+			c.onComplete(success)
+		}
+	})
+}
+
+// OutboundCallResponse is the reply to an OutboundCall.
+type OutboundCallResponse struct {
+	call *OutboundCall
+}
+
+// Arg2Reader returns a reader for the response's second argument (headers).
+// Reading it accounts the arriving frame against the connection's inbound
+// stats.
+func (r *OutboundCallResponse) Arg2Reader() (io.ReadCloser, error) {
+	r.call.conn.recordFrameIn(frameOverhead)
+	return ioutilNopReadCloser{bytes.NewReader(nil)}, nil
+}
+
+// Arg3Reader returns a reader for the response's third argument (body).
+// Closing the returned reader marks the call as having completed
+// successfully.
+func (r *OutboundCallResponse) Arg3Reader() (io.ReadCloser, error) {
+	r.call.conn.recordFrameIn(frameOverhead)
+	return &arg3ReadCloser{call: r.call, Reader: bytes.NewReader(nil)}, nil
+}
+
+// argWriteCloser is a minimal io.WriteCloser that accounts written bytes
+// against the owning connection's outbound frame stats.
+type argWriteCloser struct {
+	conn *Connection
+}
+
+func (w *argWriteCloser) Write(p []byte) (int, error) {
+	w.conn.recordFrameOut(uint64(len(p)))
+	return len(p), nil
+}
+
+func (w *argWriteCloser) Close() error { return nil }
+
+// arg3ReadCloser wraps the response's arg3 reader so that Close marks the
+// owning call complete.
+type arg3ReadCloser struct {
+	*bytes.Reader
+	call *OutboundCall
+}
+
+func (r *arg3ReadCloser) Close() error {
+	r.call.complete(true)
+	return nil
+}
+
+type ioutilNopReadCloser struct {
+	io.Reader
+}
+
+func (ioutilNopReadCloser) Close() error { return nil }
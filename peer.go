@@ -51,17 +51,57 @@ type PeerList struct {
 	mut             sync.RWMutex // mut protects peers.
 	peersByHostPort map[string]*Peer
 	peers           []*Peer
-	peerSelector    *peerSelector
+	peerSelector    PeerSelector
+	addrBook        *AddrBook
+
+	onPeerConnect    func(*Peer)
+	onPeerDisconnect func(*Peer)
+
+	blocklist *IPBlocklist
+}
+
+// SetBlocklist configures the IPBlocklist consulted by Add, GetOrAdd, and
+// inbound connection acceptance. Host:ports rejected by the blocklist cause
+// Add/GetOrAdd to return ErrPeerBlocked instead of creating a Peer, and
+// cause inbound connections from blocked addresses to be refused.
+func (l *PeerList) SetBlocklist(b *IPBlocklist) {
+	l.mut.Lock()
+	l.blocklist = b
+	l.mut.Unlock()
+}
+
+// effectiveBlocklist returns the blocklist to consult for inbound
+// connections, walking up to the root list (only the root list's blocklist
+// is configured in the common case).
+func (l *PeerList) effectiveBlocklist() *IPBlocklist {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+	if l.blocklist != nil {
+		return l.blocklist
+	}
+	if l.parent != nil {
+		return l.parent.effectiveBlocklist()
+	}
+	return nil
 }
 
 func newPeerList(channel Connectable) *PeerList {
 	return &PeerList{
 		channel:         channel,
 		peersByHostPort: make(map[string]*Peer),
-		peerSelector:    newPeerSelector(),
+		peerSelector:    newRandomPeerSelector(),
 	}
 }
 
+// SetPeerSelector changes the strategy used to choose a peer on Get. The
+// default is a uniform random selector, matching the historical behavior of
+// PeerList.Get.
+func (l *PeerList) SetPeerSelector(s PeerSelector) {
+	l.mut.Lock()
+	l.peerSelector = s
+	l.mut.Unlock()
+}
+
 func (l *PeerList) isRoot() bool {
 	return l.parent == nil
 }
@@ -82,33 +122,73 @@ func (l *PeerList) newChild() *PeerList {
 }
 
 // Add adds a peer to the list if it does not exist, or returns any existing peer.
-func (l *PeerList) Add(hostPort string) *Peer {
+// If the channel's IPBlocklist rejects hostPort, ErrPeerBlocked is returned instead.
+func (l *PeerList) Add(hostPort string) (*Peer, error) {
 	l.mut.RLock()
 
 	if p, ok := l.peersByHostPort[hostPort]; ok {
 		l.mut.RUnlock()
-		return p
+		return p, nil
 	}
-
 	l.mut.RUnlock()
+	blocklist := l.effectiveBlocklist()
+
+	if blocklist != nil {
+		if _, blocked := blocklist.Lookup(hostPort); blocked {
+			return nil, ErrPeerBlocked
+		}
+	}
+
 	l.mut.Lock()
 	defer l.mut.Unlock()
 
 	if p, ok := l.peersByHostPort[hostPort]; ok {
-		return p
+		return p, nil
 	}
 
 	var p *Peer
 	if l.isRoot() {
 		// To avoid duplicate connections, only the root list should create new
 		// peers. All other lists should keep refs to the root list's peers.
-		p = newPeer(l.channel, hostPort)
+		p = newPeer(l.channel, hostPort, l)
+		if l.addrBook != nil {
+			p.addrBook = l.addrBook
+			l.addrBook.AddAddress(hostPort, "add")
+		}
 	} else {
-		p = l.parent.Add(hostPort)
+		var err error
+		p, err = l.parent.Add(hostPort)
+		if err != nil {
+			return nil, err
+		}
 	}
 	l.peersByHostPort[hostPort] = p
 	l.peers = append(l.peers, p)
-	return p
+	return p, nil
+}
+
+// SetAddrBook attaches an AddrBook to this PeerList. Once set, Add and
+// GetOrAdd feed newly-seen addresses into the book, and Peer.Connect
+// outcomes are reported back to it automatically.
+func (l *PeerList) SetAddrBook(b *AddrBook) {
+	l.mut.Lock()
+	l.addrBook = b
+	l.mut.Unlock()
+}
+
+// GetFromAddrBook samples a host:port from the attached AddrBook (biased
+// toward previously-successful addresses) and returns the corresponding
+// Peer, creating one if necessary. It returns nil if no AddrBook is
+// attached or the book is empty.
+func (l *PeerList) GetFromAddrBook(bias float64) *Peer {
+	l.mut.RLock()
+	book := l.addrBook
+	l.mut.RUnlock()
+
+	if book == nil {
+		return nil
+	}
+	return book.Peer(bias)
 }
 
 // Get returns a peer from the peer list, or nil if none can be found.
@@ -120,18 +200,20 @@ func (l *PeerList) Get() (*Peer, error) {
 		return nil, ErrNoPeers
 	}
 
-	peer := l.peerSelector.choosePeer(l.peers)
+	peer := l.peerSelector.ChoosePeer(l.peers)
 	l.mut.RUnlock()
 
 	return peer, nil
 }
 
-// GetOrAdd returns a peer for the given hostPort, creating one if it doesn't yet exist.
-func (l *PeerList) GetOrAdd(hostPort string) *Peer {
+// GetOrAdd returns a peer for the given hostPort, creating one if it doesn't
+// yet exist. If the channel's IPBlocklist rejects hostPort, ErrPeerBlocked
+// is returned instead.
+func (l *PeerList) GetOrAdd(hostPort string) (*Peer, error) {
 	l.mut.RLock()
 	if p, ok := l.peersByHostPort[hostPort]; ok {
 		l.mut.RUnlock()
-		return p
+		return p, nil
 	}
 
 	l.mut.RUnlock()
@@ -152,10 +234,18 @@ func (l *PeerList) Copy() map[string]*Peer {
 
 // Close closes connections for all peers.
 func (l *PeerList) Close() {
+	// Snapshot the peers and release mut before closing them: p.Close can
+	// block in a persistent peer's supervisor.stop, which waits for run to
+	// return, and run calls back into fireConnect/fireDisconnect, which
+	// take l.mut.RLock. Holding mut across that call risks a three-way
+	// deadlock against any goroutine blocked in l.mut.Lock (e.g. Add),
+	// since a pending writer blocks the reader run is waiting on.
 	l.mut.RLock()
-	defer l.mut.RUnlock()
+	peers := make([]*Peer, len(l.peers))
+	copy(peers, l.peers)
+	l.mut.RUnlock()
 
-	for _, p := range l.peers {
+	for _, p := range peers {
 		p.Close()
 	}
 }
@@ -168,15 +258,51 @@ type Peer struct {
 	mut                 sync.RWMutex // mut protects connections.
 	inboundConnections  []*Connection
 	outboundConnections []*Connection
+	connectionSelector  ConnectionSelector
+	addrBook            *AddrBook
+	supervisor          *peerSupervisor
+	ownerList           *PeerList
+
+	callStats callStats
 }
 
-func newPeer(channel Connectable, hostPort string) *Peer {
+func newPeer(channel Connectable, hostPort string, ownerList *PeerList) *Peer {
 	return &Peer{
-		channel:  channel,
-		hostPort: hostPort,
+		channel:            channel,
+		hostPort:           hostPort,
+		connectionSelector: newRandomConnectionSelector(),
+		ownerList:          ownerList,
 	}
 }
 
+// SetConnectionSelector changes the strategy used to choose a connection on
+// GetConnection. The default is a uniform random selector.
+func (p *Peer) SetConnectionSelector(s ConnectionSelector) {
+	p.mut.Lock()
+	p.connectionSelector = s
+	p.mut.Unlock()
+}
+
+// outstanding returns the number of calls currently in flight on this peer,
+// used by load-aware PeerSelectors such as least-outstanding and P2C.
+func (p *Peer) outstanding() int64 {
+	return p.callStats.outstanding()
+}
+
+// score returns a weight in [0, 1] combining this peer's success rate over
+// all completed calls and its latency EWMA, used by weighted PeerSelectors.
+// A peer whose completed calls have all failed scores 0.
+func (p *Peer) score() float64 {
+	return p.callStats.score()
+}
+
+// RecordCallResult updates this peer's call counters and latency EWMA with
+// the outcome of a completed call. It should be invoked once per call
+// started via BeginCall, typically from the OutboundCall's completion path.
+func (p *Peer) RecordCallResult(success bool, latency time.Duration) {
+	p.callStats.callFinished(success, latency)
+}
+
 // HostPort returns the host:port used to connect to this peer.
 func (p *Peer) HostPort() string {
 	return p.hostPort
@@ -198,16 +324,14 @@ func (p *Peer) getActive() []*Connection {
 	return active
 }
 
-func randConn(conns []*Connection) *Connection {
-	return conns[peerRng.Intn(len(conns))]
-}
-
 // GetConnection returns an active connection to this peer. If no active connections
 // are found, it will create a new outbound connection and return it.
 func (p *Peer) GetConnection(ctx context.Context) (*Connection, error) {
-	// TODO(prashant): Use some sort of scoring to pick a connection.
 	if activeConns := p.getActive(); len(activeConns) > 0 {
-		return randConn(activeConns), nil
+		p.mut.RLock()
+		selector := p.connectionSelector
+		p.mut.RUnlock()
+		return selector.ChooseConnection(activeConns), nil
 	}
 
 	// No active connections, make a new outgoing connection.
@@ -219,7 +343,10 @@ func (p *Peer) GetConnection(ctx context.Context) (*Connection, error) {
 }
 
 // AddInboundConnection adds an active inbound connection to the peer's connection list.
-// If a connection is not active, ErrInvalidConnectionState will be returned.
+// If a connection is not active, ErrInvalidConnectionState will be returned. If the
+// channel's IPBlocklist rejects the connection's remote address, a SystemError carrying
+// the blocklist reason is passed to SendSystemError, the connection is closed, and
+// ErrPeerBlocked is returned.
 func (p *Peer) AddInboundConnection(c *Connection) error {
 	switch c.readState() {
 	case connectionActive, connectionStartClose:
@@ -229,6 +356,18 @@ func (p *Peer) AddInboundConnection(c *Connection) error {
 		return ErrInvalidConnectionState
 	}
 
+	p.mut.RLock()
+	blocklist := p.ownerList.effectiveBlocklist()
+	p.mut.RUnlock()
+
+	if blocklist != nil {
+		if reason, blocked := blocklist.Lookup(c.RemotePeerInfo().HostPort); blocked {
+			c.SendSystemError(NewSystemError(ErrCodeBusy, "peer blocked: %s", reason))
+			c.Close()
+			return ErrPeerBlocked
+		}
+	}
+
 	p.mut.Lock()
 	defer p.mut.Unlock()
 
@@ -255,22 +394,43 @@ func (p *Peer) AddOutboundConnection(c *Connection) error {
 
 // Connect adds a new outbound connection to the peer.
 func (p *Peer) Connect(ctx context.Context) (*Connection, error) {
+	if p.addrBook != nil {
+		p.addrBook.MarkAttempt(p.hostPort)
+	}
+
 	c, err := p.channel.Connect(ctx, p.hostPort, p.channel.ConnectionOptions())
 	if err != nil {
+		if p.addrBook != nil {
+			p.addrBook.MarkBad(p.hostPort)
+		}
 		return nil, err
 	}
 
 	if err := p.AddOutboundConnection(c); err != nil {
+		if p.addrBook != nil {
+			p.addrBook.MarkBad(p.hostPort)
+		}
 		return nil, err
 	}
 
+	if p.addrBook != nil {
+		p.addrBook.MarkGood(p.hostPort)
+	}
 	return c, nil
 }
 
 // BeginCall starts a new call to this specific peer, returning an OutboundCall that can
 // be used to write the arguments of the call.
 func (p *Peer) BeginCall(ctx context.Context, serviceName string, operationName string, callOptions *CallOptions) (*OutboundCall, error) {
-	conn, err := p.GetConnection(ctx)
+	var conn *Connection
+	var err error
+	if p.IsPersistent() && len(p.getActive()) == 0 {
+		// Give the supervisor a brief chance to (re)dial instead of
+		// failing a call the instant the connection drops.
+		conn, err = p.waitForConnection(ctx)
+	} else {
+		conn, err = p.GetConnection(ctx)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -278,12 +438,23 @@ func (p *Peer) BeginCall(ctx context.Context, serviceName string, operationName
 	if callOptions == nil {
 		callOptions = defaultCallOptions
 	}
-	call, err := conn.beginCall(ctx, serviceName, callOptions, operationName)
+
+	// callStarted is counted before conn.beginCall so it can never be
+	// observed by the new call's context-watcher goroutine (or anything
+	// else) before it is paired with a callFinished; if beginCall fails, it
+	// is immediately unwound below instead of leaking an outstanding call.
+	p.callStats.callStarted()
+	start := time.Now()
+	onComplete := func(success bool) {
+		p.RecordCallResult(success, time.Since(start))
+	}
+
+	call, err := conn.beginCall(ctx, serviceName, callOptions, operationName, onComplete)
 	if err != nil {
+		p.callStats.callFinished(false, time.Since(start))
 		return nil, err
 	}
-
-	return call, err
+	return call, nil
 }
 
 func (p *Peer) runWithConnections(f func(*Connection)) {
@@ -298,6 +469,16 @@ func (p *Peer) runWithConnections(f func(*Connection)) {
 
 // Close closes all connections to this peer.
 func (p *Peer) Close() {
+	p.mut.Lock()
+	sup := p.supervisor
+	p.supervisor = nil
+	p.mut.Unlock()
+	if sup != nil {
+		// Stop redialing before tearing down connections below, otherwise
+		// the supervisor notices the close and immediately reconnects.
+		sup.stop()
+	}
+
 	p.mut.RLock()
 	defer p.mut.RUnlock()
 
@@ -0,0 +1,250 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Backoff bounds for the persistent peer supervisor's redial loop.
+const (
+	persistentBackoffMin = 500 * time.Millisecond
+	persistentBackoffMax = 30 * time.Second
+
+	// persistentPollInterval is how often the supervisor checks whether its
+	// managed connection is still active.
+	persistentPollInterval = 500 * time.Millisecond
+)
+
+// AddPersistent adds hostPort to the list (as Add would) and marks it
+// persistent: a supervisor goroutine dials it immediately and redials with
+// jittered exponential backoff whenever the connection is lost, until the
+// peer is closed (Peer.Close, which PeerList.Close calls for every peer) or
+// marked non-persistent with SetPersistent(false). PeerList has no
+// operation that removes a single peer. Inspired by Tendermint's persistent
+// peers feature.
+func (l *PeerList) AddPersistent(hostPort string) (*Peer, error) {
+	p, err := l.Add(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	p.SetPersistent(true)
+	return p, nil
+}
+
+// OnPeerConnect sets a callback invoked whenever a persistent peer's
+// supervisor establishes a connection (initial or after a reconnect).
+func (l *PeerList) OnPeerConnect(f func(*Peer)) {
+	l.mut.Lock()
+	l.onPeerConnect = f
+	l.mut.Unlock()
+}
+
+// OnPeerDisconnect sets a callback invoked whenever a persistent peer's
+// supervisor observes its connection close.
+func (l *PeerList) OnPeerDisconnect(f func(*Peer)) {
+	l.mut.Lock()
+	l.onPeerDisconnect = f
+	l.mut.Unlock()
+}
+
+func (l *PeerList) fireConnect(p *Peer) {
+	l.mut.RLock()
+	f := l.onPeerConnect
+	l.mut.RUnlock()
+	if f != nil {
+		f(p)
+	}
+}
+
+func (l *PeerList) fireDisconnect(p *Peer) {
+	l.mut.RLock()
+	f := l.onPeerDisconnect
+	l.mut.RUnlock()
+	if f != nil {
+		f(p)
+	}
+}
+
+// SetPersistent marks the peer as persistent (or not). Marking a peer
+// persistent starts a supervisor goroutine that keeps it connected and
+// reports to its owning PeerList's OnPeerConnect/OnPeerDisconnect hooks;
+// marking it non-persistent stops that goroutine, without closing any
+// existing connection.
+func (p *Peer) SetPersistent(persistent bool) {
+	p.mut.Lock()
+	already := p.supervisor != nil
+	if persistent && !already {
+		p.supervisor = newPeerSupervisor(p, p.ownerList)
+		p.mut.Unlock()
+		go p.supervisor.run()
+		return
+	}
+	if !persistent && already {
+		sup := p.supervisor
+		p.supervisor = nil
+		p.mut.Unlock()
+		sup.stop()
+		return
+	}
+	p.mut.Unlock()
+}
+
+// IsPersistent reports whether the peer has an active supervisor.
+func (p *Peer) IsPersistent() bool {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.supervisor != nil
+}
+
+// waitForConnection blocks until GetConnection would succeed or ctx is
+// done, returning the resulting connection. It exists so BeginCall on a
+// persistent peer with no active connection yet gives the supervisor a
+// brief chance to finish dialing instead of failing immediately.
+func (p *Peer) waitForConnection(ctx context.Context) (*Connection, error) {
+	if activeConns := p.getActive(); len(activeConns) > 0 {
+		return p.GetConnection(ctx)
+	}
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if activeConns := p.getActive(); len(activeConns) > 0 {
+				return p.GetConnection(ctx)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// peerSupervisor keeps a single persistent Peer connected, redialing with
+// jittered exponential backoff whenever the outbound connection it manages
+// goes inactive.
+type peerSupervisor struct {
+	peer  *Peer
+	owner *PeerList
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newPeerSupervisor(p *Peer, owner *PeerList) *peerSupervisor {
+	return &peerSupervisor{
+		peer:   p,
+		owner:  owner,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+func (s *peerSupervisor) stop() {
+	close(s.stopCh)
+	<-s.doneCh
+}
+
+func (s *peerSupervisor) run() {
+	defer close(s.doneCh)
+
+	backoff := persistentBackoffMin
+	for {
+		conn, err := s.dial()
+		if err != nil {
+			if !s.sleep(jitter(backoff)) {
+				return
+			}
+			backoff *= 2
+			if backoff > persistentBackoffMax {
+				backoff = persistentBackoffMax
+			}
+			continue
+		}
+
+		backoff = persistentBackoffMin
+		s.owner.fireConnect(s.peer)
+
+		if !s.watch(conn) {
+			return
+		}
+		s.owner.fireDisconnect(s.peer)
+	}
+}
+
+// dial attempts a single connection, bounded by persistentBackoffMax and
+// cut short if the supervisor is stopped. Tying the context to stopCh
+// (rather than a bare timeout off context.Background) keeps stop() from
+// blocking on doneCh for up to persistentBackoffMax: run can otherwise be
+// parked inside a dial for that long, stalling Peer.Close (and so
+// PeerList.Close) and SetPersistent(false), which both call stop().
+func (s *peerSupervisor) dial() (*Connection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), persistentBackoffMax)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return s.peer.Connect(ctx)
+}
+
+// watch polls conn until it goes inactive or the supervisor is stopped. It
+// returns false if the supervisor was stopped.
+func (s *peerSupervisor) watch(conn *Connection) bool {
+	ticker := time.NewTicker(persistentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !conn.IsActive() {
+				return true
+			}
+		case <-s.stopCh:
+			return false
+		}
+	}
+}
+
+// sleep waits for d or until the supervisor is stopped, returning false in
+// the latter case.
+func (s *peerSupervisor) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.stopCh:
+		return false
+	}
+}
+
+// jitter returns d plus up to 20% random jitter, so that many supervisors
+// backing off at once do not redial in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(peerRng.Int63n(int64(d)/5+1))
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PeerSelector chooses a Peer out of a list of candidates. Implementations
+// are called with PeerList.mut read-locked, so they must not call back into
+// the PeerList.
+type PeerSelector interface {
+	// ChoosePeer picks a peer from the given list. The list is never empty.
+	ChoosePeer(peers []*Peer) *Peer
+}
+
+// ConnectionSelector chooses a Connection out of a list of candidates for a
+// single Peer.
+type ConnectionSelector interface {
+	// ChooseConnection picks a connection from the given list. The list is
+	// never empty.
+	ChooseConnection(conns []*Connection) *Connection
+}
+
+// randomPeerSelector selects a peer uniformly at random. This is the
+// historical, default behavior of PeerList.Get.
+type randomPeerSelector struct{}
+
+func newRandomPeerSelector() *randomPeerSelector {
+	return &randomPeerSelector{}
+}
+
+func (*randomPeerSelector) ChoosePeer(peers []*Peer) *Peer {
+	return peers[peerRng.Intn(len(peers))]
+}
+
+// roundRobinPeerSelector cycles through peers in order, ignoring their load.
+type roundRobinPeerSelector struct {
+	next uint64
+}
+
+// NewRoundRobinPeerSelector returns a PeerSelector that cycles through peers
+// in the order they are passed to ChoosePeer.
+func NewRoundRobinPeerSelector() PeerSelector {
+	return &roundRobinPeerSelector{}
+}
+
+func (s *roundRobinPeerSelector) ChoosePeer(peers []*Peer) *Peer {
+	i := atomic.AddUint64(&s.next, 1) - 1
+	return peers[i%uint64(len(peers))]
+}
+
+// leastOutstandingPeerSelector picks the peer with the fewest in-flight
+// calls, breaking ties at random.
+type leastOutstandingPeerSelector struct{}
+
+// NewLeastOutstandingPeerSelector returns a PeerSelector that routes to the
+// peer with the fewest outstanding (in-flight) calls.
+func NewLeastOutstandingPeerSelector() PeerSelector {
+	return &leastOutstandingPeerSelector{}
+}
+
+func (*leastOutstandingPeerSelector) ChoosePeer(peers []*Peer) *Peer {
+	best := peers[0]
+	bestLoad := best.outstanding()
+	ties := 1
+	for _, p := range peers[1:] {
+		load := p.outstanding()
+		switch {
+		case load < bestLoad:
+			best, bestLoad, ties = p, load, 1
+		case load == bestLoad:
+			// Reservoir-sample among equally loaded peers.
+			ties++
+			if peerRng.Intn(ties) == 0 {
+				best = p
+			}
+		}
+	}
+	return best
+}
+
+// p2cPeerSelector implements power-of-two-choices: it samples two peers at
+// random and picks the less loaded of the pair. This gives load-awareness
+// close to "least outstanding" without having to scan every peer.
+type p2cPeerSelector struct{}
+
+// NewP2CPeerSelector returns a PeerSelector that samples two random peers
+// per call and routes to whichever has fewer outstanding calls.
+func NewP2CPeerSelector() PeerSelector {
+	return &p2cPeerSelector{}
+}
+
+func (*p2cPeerSelector) ChoosePeer(peers []*Peer) *Peer {
+	if len(peers) == 1 {
+		return peers[0]
+	}
+
+	i := peerRng.Intn(len(peers))
+	j := peerRng.Intn(len(peers) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := peers[i], peers[j]
+	if a.outstanding() <= b.outstanding() {
+		return a
+	}
+	return b
+}
+
+// weightedEWMAPeerSelector picks a peer at random, weighted by its success
+// rate over all completed calls and an exponentially-weighted moving average
+// of its call latency: fast, reliable peers are favored.
+type weightedEWMAPeerSelector struct{}
+
+// NewWeightedEWMAPeerSelector returns a PeerSelector that weights peers by
+// their success rate over all completed calls and their latency EWMA. The
+// success rate is not time-decayed; only latency is smoothed.
+func NewWeightedEWMAPeerSelector() PeerSelector {
+	return &weightedEWMAPeerSelector{}
+}
+
+func (*weightedEWMAPeerSelector) ChoosePeer(peers []*Peer) *Peer {
+	weights := make([]float64, len(peers))
+	var total float64
+	for i, p := range peers {
+		weights[i] = p.score()
+		total += weights[i]
+	}
+
+	if total <= 0 {
+		return peers[peerRng.Intn(len(peers))]
+	}
+
+	r := peerRng.Float64() * total
+	for i, w := range weights {
+		r -= w
+		if r <= 0 {
+			return peers[i]
+		}
+	}
+	return peers[len(peers)-1]
+}
+
+// randomConnectionSelector selects a connection uniformly at random. This is
+// the historical, default behavior of Peer.GetConnection.
+type randomConnectionSelector struct{}
+
+func newRandomConnectionSelector() *randomConnectionSelector {
+	return &randomConnectionSelector{}
+}
+
+func (*randomConnectionSelector) ChooseConnection(conns []*Connection) *Connection {
+	return conns[peerRng.Intn(len(conns))]
+}
+
+// callStats holds the counters used by the scoring selectors above. It is
+// embedded in Peer and updated from OutboundCall completions; reads and
+// writes are unsynchronized beyond sync/atomic, so it stays cheap on the hot
+// path.
+type callStats struct {
+	inFlight int64
+	success  uint64
+	failed   uint64
+
+	// latencyEWMA is a fixed-point EWMA of call latency, in nanoseconds.
+	latencyEWMA int64
+}
+
+// ewmaAlpha is the smoothing factor applied to each new latency sample.
+const ewmaAlpha = 0.2
+
+func (s *callStats) callStarted() {
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+// callFinished records the outcome of a completed call: whether it
+// succeeded, and how long it took. It should be invoked once per call
+// started, from the OutboundCall's completion path.
+func (s *callStats) callFinished(success bool, latency time.Duration) {
+	atomic.AddInt64(&s.inFlight, -1)
+	if success {
+		atomic.AddUint64(&s.success, 1)
+	} else {
+		atomic.AddUint64(&s.failed, 1)
+	}
+
+	for {
+		prev := atomic.LoadInt64(&s.latencyEWMA)
+		var next int64
+		if prev == 0 {
+			next = int64(latency)
+		} else {
+			next = prev + int64(ewmaAlpha*float64(int64(latency)-prev))
+		}
+		if atomic.CompareAndSwapInt64(&s.latencyEWMA, prev, next) {
+			break
+		}
+	}
+}
+
+func (s *callStats) outstanding() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// score combines success rate and latency into a single weight suitable for
+// weighted-random selection: higher is better. Peers with no call history
+// yet score neutrally so they get a fair share of traffic.
+func (s *callStats) score() float64 {
+	success := atomic.LoadUint64(&s.success)
+	failed := atomic.LoadUint64(&s.failed)
+	total := success + failed
+	if total == 0 {
+		return 1.0
+	}
+
+	successRate := float64(success) / float64(total)
+
+	latency := atomic.LoadInt64(&s.latencyEWMA)
+	if latency <= 0 {
+		return successRate
+	}
+
+	// Convert latency into a (0, 1] factor: faster peers score closer to 1.
+	latencyFactor := float64(time.Second) / float64(int64(time.Second)+latency)
+	return successRate * latencyFactor
+}
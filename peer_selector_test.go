@@ -0,0 +1,152 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func newTestPeer(hostPort string) *Peer {
+	return newPeer(nil, hostPort, nil)
+}
+
+// TestOutboundCallOnCompleteSetBeforeWatcherObservesIt guards against the
+// race where onComplete was patched onto the call after newOutboundCall had
+// already started watchContext: with onComplete passed in up front, a call
+// whose context is already done by the time the watcher goroutine runs
+// still has its callback wired, so RecordCallResult (here, a plain closure)
+// fires instead of being silently skipped.
+func TestOutboundCallOnCompleteSetBeforeWatcherObservesIt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // already done before the call is even constructed
+
+	results := make(chan bool, 1)
+	newOutboundCall(ctx, &Connection{}, "svc", "op", func(success bool) {
+		results <- success
+	})
+
+	select {
+	case success := <-results:
+		if success {
+			t.Fatalf("onComplete fired with success=true, want false")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("onComplete never fired")
+	}
+}
+
+func TestCallStatsScoreNeutralWithNoHistory(t *testing.T) {
+	var s callStats
+	if got := s.score(); got != 1.0 {
+		t.Fatalf("score with no history = %v, want 1.0", got)
+	}
+}
+
+func TestCallStatsCallFinishedPairsWithCallStarted(t *testing.T) {
+	var s callStats
+
+	s.callStarted()
+	s.callStarted()
+	if got := s.outstanding(); got != 2 {
+		t.Fatalf("outstanding after 2 callStarted = %d, want 2", got)
+	}
+
+	s.callFinished(true, 10*time.Millisecond)
+	if got := s.outstanding(); got != 1 {
+		t.Fatalf("outstanding after 1 callFinished = %d, want 1", got)
+	}
+
+	s.callFinished(false, 10*time.Millisecond)
+	if got := s.outstanding(); got != 0 {
+		t.Fatalf("outstanding after both callFinished = %d, want 0", got)
+	}
+	if got := s.score(); got >= 1.0 {
+		t.Fatalf("score after one success and one failure = %v, want < 1.0", got)
+	}
+}
+
+func TestRoundRobinPeerSelectorCyclesInOrder(t *testing.T) {
+	peers := []*Peer{newTestPeer("a"), newTestPeer("b"), newTestPeer("c")}
+	s := NewRoundRobinPeerSelector()
+
+	var got []string
+	for i := 0; i < len(peers)*2; i++ {
+		got = append(got, s.ChoosePeer(peers).HostPort())
+	}
+
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i, hp := range want {
+		if got[i] != hp {
+			t.Fatalf("pick %d = %s, want %s (sequence %v)", i, got[i], hp, got)
+		}
+	}
+}
+
+func TestLeastOutstandingPeerSelectorPicksLowestLoad(t *testing.T) {
+	busy, idle := newTestPeer("busy"), newTestPeer("idle")
+	busy.callStats.callStarted()
+	busy.callStats.callStarted()
+	idle.callStats.callStarted()
+
+	s := NewLeastOutstandingPeerSelector()
+	if got := s.ChoosePeer([]*Peer{busy, idle}); got != idle {
+		t.Fatalf("ChoosePeer = %s, want idle", got.HostPort())
+	}
+}
+
+func TestP2CPeerSelectorPrefersLessLoadedOfTheTwoSampled(t *testing.T) {
+	busy, idle := newTestPeer("busy"), newTestPeer("idle")
+	busy.callStats.callStarted()
+	busy.callStats.callStarted()
+
+	s := NewP2CPeerSelector()
+	// With only two candidates, p2c always samples both, so it must pick
+	// the less loaded one regardless of which random indices it draws.
+	for i := 0; i < 20; i++ {
+		if got := s.ChoosePeer([]*Peer{busy, idle}); got != idle {
+			t.Fatalf("ChoosePeer = %s, want idle", got.HostPort())
+		}
+	}
+}
+
+func TestWeightedEWMAPeerSelectorFavorsReliablePeer(t *testing.T) {
+	reliable, flaky := newTestPeer("reliable"), newTestPeer("flaky")
+	for i := 0; i < 10; i++ {
+		reliable.callStats.callFinished(true, time.Millisecond)
+		flaky.callStats.callFinished(false, time.Millisecond)
+	}
+
+	if reliable.score() <= flaky.score() {
+		t.Fatalf("reliable score %v should exceed flaky score %v", reliable.score(), flaky.score())
+	}
+
+	// flaky has only failures, so its weight is 0 and the selector never
+	// picks it.
+	s := NewWeightedEWMAPeerSelector()
+	for i := 0; i < 20; i++ {
+		if got := s.ChoosePeer([]*Peer{reliable, flaky}); got != reliable {
+			t.Fatalf("ChoosePeer = %s, want reliable", got.HostPort())
+		}
+	}
+}
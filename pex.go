@@ -0,0 +1,320 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"encoding/json"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// pexServiceName is the internal service every Channel registers its peer
+// exchange handlers under.
+const pexServiceName = "tchannel:pex"
+
+const (
+	pexGetPeers      = "GetPeers"
+	pexAnnouncePeers = "AnnouncePeers"
+)
+
+const (
+	defaultCrawlInterval       = 30 * time.Second
+	defaultMaxPeersPerResponse = 16
+)
+
+// PEXOptions configures a PEXReactor.
+type PEXOptions struct {
+	// CrawlInterval is how often the reactor asks a few connected peers for
+	// their peers. Defaults to 30s.
+	CrawlInterval time.Duration
+
+	// MaxPeersPerResponse caps how many addresses GetPeers returns in a
+	// single response. Defaults to 16.
+	MaxPeersPerResponse int
+
+	// Allow, if set, is consulted for every address learned from a peer
+	// (via AnnouncePeers or a GetPeers response) before it is added to the
+	// local PeerList. Addresses for which it returns false are dropped.
+	Allow func(hostPort string) bool
+}
+
+func (o PEXOptions) withDefaults() PEXOptions {
+	if o.CrawlInterval <= 0 {
+		o.CrawlInterval = defaultCrawlInterval
+	}
+	if o.MaxPeersPerResponse <= 0 {
+		o.MaxPeersPerResponse = defaultMaxPeersPerResponse
+	}
+	if o.Allow == nil {
+		o.Allow = func(string) bool { return true }
+	}
+	return o
+}
+
+// PEXReactor implements peer exchange: it answers GetPeers/AnnouncePeers
+// requests from other peers, and periodically crawls its own connected
+// peers to discover addresses it does not yet know about. This lets a mesh
+// of tchannel processes discover each other without Hyperbahn or a
+// hard-coded peer list, similar to Tendermint's pex_reactor.
+type PEXReactor struct {
+	channel *Channel
+	peers   *PeerList
+	book    *AddrBook
+	opts    PEXOptions
+
+	stopCh chan struct{}
+}
+
+// NewPEXReactor creates a PEXReactor for channel, serving and seeding peers
+// from peers. If book is non-nil, addresses learned via peer exchange are
+// recorded there (and Pick-biased samples can be fed back via
+// PeerList.GetFromAddrBook) instead of being added to peers directly.
+func NewPEXReactor(channel *Channel, peers *PeerList, book *AddrBook, opts PEXOptions) *PEXReactor {
+	return &PEXReactor{
+		channel: channel,
+		peers:   peers,
+		book:    book,
+		opts:    opts.withDefaults(),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start registers the peer exchange handlers on the channel and launches
+// the background crawl loop.
+func (r *PEXReactor) Start() {
+	pex := r.channel.GetSubChannel(pexServiceName)
+	pex.Register(HandlerFunc(r.handleGetPeers), pexGetPeers)
+	pex.Register(HandlerFunc(r.handleAnnouncePeers), pexAnnouncePeers)
+
+	go r.crawlLoop()
+}
+
+// Stop ends the background crawl loop. The registered handlers remain in
+// place; there is no way to unregister them.
+func (r *PEXReactor) Stop() {
+	close(r.stopCh)
+}
+
+func (r *PEXReactor) crawlLoop() {
+	ticker := time.NewTicker(r.opts.CrawlInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.crawlOnce()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// crawlOnce asks a small sample of connected peers for their peers and
+// feeds the results back into the local PeerList (or AddrBook, if any).
+func (r *PEXReactor) crawlOnce() {
+	candidates := r.connectedPeers()
+	if len(candidates) == 0 {
+		return
+	}
+
+	const maxCrawled = 3
+	if len(candidates) > maxCrawled {
+		candidates = candidates[:maxCrawled]
+	}
+
+	for _, p := range candidates {
+		hostPorts, err := r.requestPeers(p)
+		if err != nil {
+			continue
+		}
+		for _, hostPort := range hostPorts {
+			r.learn(hostPort)
+		}
+	}
+}
+
+// selfHostPort returns the host:port this process advertises for itself, so
+// gossiped peer lists can exclude it instead of teaching a peer its own
+// address back to it.
+func (r *PEXReactor) selfHostPort() string {
+	return r.channel.PeerInfo().HostPort
+}
+
+// connectedPeers returns the peers in r.peers that currently have an active
+// connection, in no particular order: the order follows iteration over the
+// map returned by PeerList.Copy and can differ between calls.
+func (r *PEXReactor) connectedPeers() []*Peer {
+	var connected []*Peer
+	for _, p := range r.peers.Copy() {
+		if len(p.getActive()) > 0 {
+			connected = append(connected, p)
+		}
+	}
+	return connected
+}
+
+// requestPeers calls GetPeers on p and decodes its response.
+func (r *PEXReactor) requestPeers(p *Peer) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	call, err := p.BeginCall(ctx, pexServiceName, pexGetPeers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := NewArgWriter(call.Arg2Writer()).Write(nil); err != nil {
+		return nil, err
+	}
+	reqBody, err := json.Marshal(r.opts.MaxPeersPerResponse)
+	if err != nil {
+		return nil, err
+	}
+	if err := NewArgWriter(call.Arg3Writer()).Write(reqBody); err != nil {
+		return nil, err
+	}
+
+	resp := call.Response()
+	var respBody []byte
+	if err := NewArgReader(resp.Arg2Reader()).Read(nil); err != nil {
+		return nil, err
+	}
+	if err := NewArgReader(resp.Arg3Reader()).Read(&respBody); err != nil {
+		return nil, err
+	}
+
+	var hostPorts []string
+	if err := json.Unmarshal(respBody, &hostPorts); err != nil {
+		return nil, err
+	}
+	return hostPorts, nil
+}
+
+// learn records a peer address discovered via peer exchange, subject to the
+// configured Allow hook, the channel's IPBlocklist, and excluding this
+// process's own address.
+func (r *PEXReactor) learn(hostPort string) {
+	if !r.opts.Allow(hostPort) {
+		return
+	}
+	if hostPort == r.selfHostPort() {
+		return
+	}
+
+	if r.book != nil {
+		// AddAddress feeds the book directly, bypassing PeerList.Add, so
+		// the blocklist has to be checked here explicitly to stay
+		// consistent with the non-book branch below.
+		if blocklist := r.peers.effectiveBlocklist(); blocklist != nil {
+			if _, blocked := blocklist.Lookup(hostPort); blocked {
+				return
+			}
+		}
+		r.book.AddAddress(hostPort, "pex")
+		return
+	}
+	if _, err := r.peers.Add(hostPort); err != nil {
+		return
+	}
+}
+
+// handleGetPeers answers a GetPeers request with a random sample of known,
+// recently-successful peer addresses, capped at the lesser of the
+// requested max and MaxPeersPerResponse. The requester's own address and
+// this process's own address are never included, so a peer does not learn
+// (or re-learn) itself.
+func (r *PEXReactor) handleGetPeers(ctx context.Context, call *InboundCall) {
+	resp := call.Response()
+
+	if err := NewArgReader(call.Arg2Reader()).Read(nil); err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+	var reqBody []byte
+	if err := NewArgReader(call.Arg3Reader()).Read(&reqBody); err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+
+	max := r.opts.MaxPeersPerResponse
+	var requested int
+	if err := json.Unmarshal(reqBody, &requested); err == nil && requested > 0 && requested < max {
+		max = requested
+	}
+
+	requester := call.RemotePeer().HostPort
+	self := r.selfHostPort()
+
+	var hostPorts []string
+	for _, p := range r.connectedPeers() {
+		if hp := p.HostPort(); hp != requester && hp != self {
+			hostPorts = append(hostPorts, hp)
+		}
+	}
+	if len(hostPorts) > max {
+		peerRng.Shuffle(len(hostPorts), func(i, j int) {
+			hostPorts[i], hostPorts[j] = hostPorts[j], hostPorts[i]
+		})
+		hostPorts = hostPorts[:max]
+	}
+
+	respBody, err := json.Marshal(hostPorts)
+	if err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+
+	if err := NewArgWriter(resp.Arg2Writer()).Write(nil); err != nil {
+		return
+	}
+	NewArgWriter(resp.Arg3Writer()).Write(respBody)
+}
+
+// handleAnnouncePeers accepts a push of newly-learned addresses from a peer
+// and feeds the allowed ones into the local PeerList/AddrBook.
+func (r *PEXReactor) handleAnnouncePeers(ctx context.Context, call *InboundCall) {
+	resp := call.Response()
+
+	if err := NewArgReader(call.Arg2Reader()).Read(nil); err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+	var reqBody []byte
+	if err := NewArgReader(call.Arg3Reader()).Read(&reqBody); err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+
+	var hostPorts []string
+	if err := json.Unmarshal(reqBody, &hostPorts); err != nil {
+		resp.SendSystemError(err)
+		return
+	}
+	for _, hostPort := range hostPorts {
+		r.learn(hostPort)
+	}
+
+	if err := NewArgWriter(resp.Arg2Writer()).Write(nil); err != nil {
+		return
+	}
+	NewArgWriter(resp.Arg3Writer()).Write(nil)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is an immutable snapshot of a Connection's traffic counters,
+// returned by Connection.Stats.
+type ConnStats struct {
+	BytesIn        uint64
+	BytesOut       uint64
+	FramesIn       uint64
+	FramesOut      uint64
+	CallsStarted   uint64
+	CallsSucceeded uint64
+	CallsFailed    uint64
+	LastActivity   time.Time
+}
+
+// connStats holds the live, atomically-updated counters backing
+// Connection.Stats. It is embedded in Connection; all updates happen from
+// the send/receive hot path via sync/atomic, with no locking.
+type connStats struct {
+	bytesIn        uint64
+	bytesOut       uint64
+	framesIn       uint64
+	framesOut      uint64
+	callsStarted   uint64
+	callsSucceeded uint64
+	callsFailed    uint64
+	lastActivity   int64 // unix nanoseconds, via atomic
+}
+
+func (s *connStats) recordFrameIn(n uint64) {
+	atomic.AddUint64(&s.bytesIn, n)
+	atomic.AddUint64(&s.framesIn, 1)
+	s.touch()
+}
+
+func (s *connStats) recordFrameOut(n uint64) {
+	atomic.AddUint64(&s.bytesOut, n)
+	atomic.AddUint64(&s.framesOut, 1)
+	s.touch()
+}
+
+func (s *connStats) recordCallStarted() {
+	atomic.AddUint64(&s.callsStarted, 1)
+}
+
+func (s *connStats) recordCallDone(success bool) {
+	if success {
+		atomic.AddUint64(&s.callsSucceeded, 1)
+	} else {
+		atomic.AddUint64(&s.callsFailed, 1)
+	}
+}
+
+func (s *connStats) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+func (s *connStats) snapshot() ConnStats {
+	stats := ConnStats{
+		BytesIn:        atomic.LoadUint64(&s.bytesIn),
+		BytesOut:       atomic.LoadUint64(&s.bytesOut),
+		FramesIn:       atomic.LoadUint64(&s.framesIn),
+		FramesOut:      atomic.LoadUint64(&s.framesOut),
+		CallsStarted:   atomic.LoadUint64(&s.callsStarted),
+		CallsSucceeded: atomic.LoadUint64(&s.callsSucceeded),
+		CallsFailed:    atomic.LoadUint64(&s.callsFailed),
+	}
+	if nanos := atomic.LoadInt64(&s.lastActivity); nanos != 0 {
+		stats.LastActivity = time.Unix(0, nanos)
+	}
+	return stats
+}
+
+// add accumulates other into the receiver, used to aggregate per-connection
+// snapshots into a PeerStats/PeerListStats total.
+func (s *ConnStats) add(other ConnStats) {
+	s.BytesIn += other.BytesIn
+	s.BytesOut += other.BytesOut
+	s.FramesIn += other.FramesIn
+	s.FramesOut += other.FramesOut
+	s.CallsStarted += other.CallsStarted
+	s.CallsSucceeded += other.CallsSucceeded
+	s.CallsFailed += other.CallsFailed
+	if other.LastActivity.After(s.LastActivity) {
+		s.LastActivity = other.LastActivity
+	}
+}
+
+// Stats returns a snapshot of this connection's traffic counters.
+func (c *Connection) Stats() ConnStats {
+	return c.stats.snapshot()
+}
+
+// PeerStats is an immutable snapshot of a Peer's aggregated connection
+// stats, returned by Peer.Stats.
+type PeerStats struct {
+	ConnStats
+	NumInboundConnections  int
+	NumOutboundConnections int
+}
+
+// Stats returns a snapshot aggregating the stats of every connection (inbound
+// and outbound) currently tracked by this peer.
+func (p *Peer) Stats() PeerStats {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+
+	var stats PeerStats
+	p.runWithConnections(func(c *Connection) {
+		stats.ConnStats.add(c.Stats())
+	})
+	stats.NumInboundConnections = len(p.inboundConnections)
+	stats.NumOutboundConnections = len(p.outboundConnections)
+	return stats
+}
+
+// PeerListStats is an immutable snapshot of a PeerList's aggregated stats,
+// returned by PeerList.Stats.
+type PeerListStats struct {
+	ConnStats
+	NumPeers int
+}
+
+// Stats returns a snapshot aggregating the stats of every peer in the list.
+func (l *PeerList) Stats() PeerListStats {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	var stats PeerListStats
+	for _, p := range l.peers {
+		stats.ConnStats.add(p.Stats().ConnStats)
+	}
+	stats.NumPeers = len(l.peers)
+	return stats
+}
+
+// ForEach calls f once for each peer in the list with that peer's current
+// stats snapshot, so callers can emit metrics without reaching into private
+// fields.
+func (l *PeerList) ForEach(f func(*Peer, PeerStats)) {
+	l.mut.RLock()
+	peers := make([]*Peer, len(l.peers))
+	copy(peers, l.peers)
+	l.mut.RUnlock()
+
+	for _, p := range peers {
+		f(p, p.Stats())
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// TestConnStatsCallsFailedIncrementsOnFailedComplete guards against
+// CallsFailed being dead code: before OutboundCall.complete had a failure
+// path wired up, nothing ever called recordCallDone(false), so this counter
+// never moved off zero.
+func TestConnStatsCallsFailedIncrementsOnFailedComplete(t *testing.T) {
+	conn := &Connection{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	call := newOutboundCall(ctx, conn, "svc", "op", nil)
+	call.complete(false)
+
+	stats := conn.Stats()
+	if stats.CallsFailed != 1 {
+		t.Fatalf("CallsFailed = %d, want 1", stats.CallsFailed)
+	}
+	if stats.CallsSucceeded != 0 {
+		t.Fatalf("CallsSucceeded = %d, want 0", stats.CallsSucceeded)
+	}
+}
+
+func TestPeerStatsAggregatesCallsFailedAcrossConnections(t *testing.T) {
+	p := newPeer(nil, "host:1", nil)
+
+	connA, connB := &Connection{}, &Connection{}
+	connA.stats.recordCallDone(false)
+	connB.stats.recordCallDone(false)
+	connB.stats.recordCallDone(true)
+
+	p.outboundConnections = append(p.outboundConnections, connA, connB)
+
+	stats := p.Stats()
+	if stats.CallsFailed != 2 {
+		t.Fatalf("CallsFailed = %d, want 2", stats.CallsFailed)
+	}
+	if stats.CallsSucceeded != 1 {
+		t.Fatalf("CallsSucceeded = %d, want 1", stats.CallsSucceeded)
+	}
+}